@@ -0,0 +1,140 @@
+package session
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestEncryptedHandshakeRoundTrip(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	type result struct {
+		sess *Session
+		err  error
+	}
+	clientCh := make(chan result, 1)
+	go func() {
+		s, err := handshakeEncrypted(clientConn, true)
+		clientCh <- result{s, err}
+	}()
+
+	serverSess, err := handshakeEncrypted(serverConn, false)
+	if err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+
+	clientRes := <-clientCh
+	if clientRes.err != nil {
+		t.Fatalf("client handshake: %v", clientRes.err)
+	}
+	clientSess := clientRes.sess
+
+	done := make(chan error, 1)
+	go func() {
+		done <- clientSess.SendSecret("sesame")
+	}()
+
+	got, err := serverSess.RecvSecret()
+	if err != nil {
+		t.Fatalf("RecvSecret: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("SendSecret: %v", err)
+	}
+	if got != "sesame" {
+		t.Fatalf("got %q, want %q", got, "sesame")
+	}
+}
+
+func TestEncryptedEmptyFrameDoesNotDesyncStream(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	clientCh := make(chan *Session, 1)
+	go func() {
+		s, err := handshakeEncrypted(clientConn, true)
+		if err != nil {
+			t.Errorf("client handshake: %v", err)
+		}
+		clientCh <- s
+	}()
+
+	serverSess, err := handshakeEncrypted(serverConn, false)
+	if err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	clientSess := <-clientCh
+
+	// An empty frame used to seal a standalone envelope that DecodeBytes
+	// never consumed, desyncing every frame sent after it.
+	done := make(chan error, 1)
+	go func() {
+		if err := clientSess.SendSecret(""); err != nil {
+			done <- err
+			return
+		}
+		done <- clientSess.SendFileName("resumed.txt")
+	}()
+
+	if got, err := serverSess.RecvSecret(); err != nil {
+		t.Fatalf("RecvSecret: %v", err)
+	} else if got != "" {
+		t.Fatalf("RecvSecret: got %q, want empty", got)
+	}
+
+	got, err := serverSess.RecvFileName()
+	if err != nil {
+		t.Fatalf("RecvFileName: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("send side: %v", err)
+	}
+	if got != "resumed.txt" {
+		t.Fatalf("RecvFileName: got %q, want %q", got, "resumed.txt")
+	}
+}
+
+func TestSealedFrameTamperDetected(t *testing.T) {
+	var shared [32]byte
+	copy(shared[:], bytes.Repeat([]byte{0x42}, len(shared)))
+
+	var buf bytes.Buffer
+	sw := &sealingWriter{w: &buf, shared: &shared, dir: dirClientToServer}
+	if _, err := sw.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	tampered := buf.Bytes()
+	tampered[len(tampered)-1] ^= 0xFF
+
+	or := &openingReader{r: bytes.NewReader(tampered), shared: &shared, dir: dirClientToServer}
+	out := make([]byte, 32)
+	if _, err := or.Read(out); err == nil {
+		t.Fatal("Read: expected error for tampered ciphertext, got nil")
+	}
+}
+
+func TestSealedFrameRoundTrip(t *testing.T) {
+	var shared [32]byte
+	copy(shared[:], bytes.Repeat([]byte{0x7}, len(shared)))
+
+	var buf bytes.Buffer
+	sw := &sealingWriter{w: &buf, shared: &shared, dir: dirServerToClient}
+	want := []byte("the quick brown fox")
+	if _, err := sw.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	or := &openingReader{r: &buf, shared: &shared, dir: dirServerToClient}
+	got := make([]byte, len(want))
+	if _, err := or.Read(got); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Legacy (pre-V2) frame helpers: a frame on the wire is a single length
+// byte L followed by L bytes, the first of which is the field type. This
+// is what Session falls back to for a peer that never spoke the
+// wire.Magic handshake. See pkg/wire for the V2 replacement.
+
+func encodeString(fieldType byte, v string) ([]byte, error) {
+	if len(v) > 254 {
+		return nil, fmt.Errorf("encodeString: too long: %v", len(v))
+	}
+	bs := make([]byte, 2+len(v))
+	bs[0] = byte(1 + len(v))
+	bs[1] = fieldType
+	copy(bs[2:], v)
+	return bs, nil
+}
+
+func decodeString(f []byte) (byte, string, error) {
+	if len(f) < 2 {
+		return 0, "", fmt.Errorf("decodeString: frame too short: %v", len(f))
+	}
+	return f[1], string(f[2:]), nil
+}
+
+func encodeUint32(fieldType byte, v uint32) ([]byte, error) {
+	bs := make([]byte, 2+4)
+	bs[0] = byte(1 + 4)
+	bs[1] = fieldType
+	binary.BigEndian.PutUint32(bs[2:], v)
+	return bs, nil
+}
+
+func decodeUint32(f []byte) (byte, uint32, error) {
+	if len(f) != 6 {
+		return 0, 0, fmt.Errorf("decodeUint32: bad length: %v", len(f))
+	}
+	return f[1], binary.BigEndian.Uint32(f[2:6]), nil
+}
+
+// EncodeByte encodes a single-byte message with no field type of its own;
+// the byte's value carries its own meaning (e.g. MsgSend, MsgRecv).
+func EncodeByte(b byte) ([]byte, error) {
+	return []byte{1, b}, nil
+}
+
+// DecodeByte decodes a frame written by EncodeByte.
+func DecodeByte(f []byte) (byte, error) {
+	if len(f) != 2 {
+		return 0, fmt.Errorf("DecodeByte: bad length: %v", len(f))
+	}
+	if f[0] != 1 {
+		return 0, fmt.Errorf("DecodeByte: bad length byte: %v", f[0])
+	}
+	return f[1], nil
+}
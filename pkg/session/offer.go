@@ -0,0 +1,326 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Encoded transfer offer manifest.
+	msgOffer byte = 6
+
+	// Encoded offer acceptance.
+	msgOfferAccept byte = 7
+
+	// Encoded offer rejection, carrying a reason string.
+	msgOfferReject byte = 8
+)
+
+// Entry describes one file or directory within a transfer offer.
+type Entry struct {
+	RelPath string
+	Size    int64
+	Mode    uint32
+	SHA256  [32]byte
+	IsDir   bool
+}
+
+// BuildEntries walks root and builds the Entry list for a transfer offer,
+// hashing every regular file along the way. Callers pass the result to
+// SendOffer, which caches it on the Session so a following SendFiles can
+// stream the bytes the offer promised without walking root a second time.
+func BuildEntries(root string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		e := Entry{
+			RelPath: filepath.ToSlash(rel),
+			Mode:    uint32(info.Mode()),
+			IsDir:   info.IsDir(),
+		}
+		if info.IsDir() {
+			entries = append(entries, e)
+			return nil
+		}
+
+		e.Size = info.Size()
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		e.SHA256 = sum
+
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build entries: %w", err)
+	}
+	return entries, nil
+}
+
+func sha256File(path string) ([32]byte, error) {
+	var sum [32]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// SendOffer sends the manifest for a multi-file transfer. The receiver
+// decides whether to go ahead with AcceptOffer or RejectOffer before any
+// file bytes are sent. entries are kept on the Session so a following
+// SendFiles streams the files that were offered, without re-walking and
+// re-hashing the tree.
+func (s *Session) SendOffer(entries []Entry) error {
+	if !s.v2 {
+		return fmt.Errorf("send offer: requires V2 framing")
+	}
+	bs, err := encodeEntries(entries)
+	if err != nil {
+		return fmt.Errorf("send offer: %w", err)
+	}
+	if err := s.enc.EncodeBytes(msgOffer, bs); err != nil {
+		return fmt.Errorf("send offer: %w", err)
+	}
+	s.offeredEntries = entries
+	return nil
+}
+
+// RecvOffer receives the manifest sent by SendOffer. The entries are kept
+// on the Session so a following RecvFiles knows what to expect.
+func (s *Session) RecvOffer() ([]Entry, error) {
+	if !s.v2 {
+		return nil, fmt.Errorf("recv offer: requires V2 framing")
+	}
+	ft, bs, err := s.dec.DecodeBytes()
+	if err != nil {
+		return nil, fmt.Errorf("recv offer: %w", err)
+	}
+	if ft != msgOffer {
+		return nil, fmt.Errorf("expected %v, got %v", msgOffer, ft)
+	}
+
+	entries, err := decodeEntries(bs)
+	if err != nil {
+		return nil, fmt.Errorf("recv offer: %w", err)
+	}
+
+	s.offerEntries = entries
+	return entries, nil
+}
+
+// AcceptOffer tells the sender to go ahead with SendFiles.
+func (s *Session) AcceptOffer() error {
+	if err := s.enc.EncodeByte(msgOfferAccept, 1); err != nil {
+		return fmt.Errorf("accept offer: %w", err)
+	}
+	return nil
+}
+
+// RejectOffer declines the offer before any file bytes flow.
+func (s *Session) RejectOffer(reason string) error {
+	if err := s.enc.EncodeString(msgOfferReject, reason); err != nil {
+		return fmt.Errorf("reject offer: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) recvOfferResponse() error {
+	ft, bs, err := s.dec.DecodeBytes()
+	if err != nil {
+		return fmt.Errorf("recv offer response: %w", err)
+	}
+	switch ft {
+	case msgOfferAccept:
+		return nil
+	case msgOfferReject:
+		return fmt.Errorf("offer rejected: %s", string(bs))
+	default:
+		return fmt.Errorf("expected offer response, got %v", ft)
+	}
+}
+
+// SendFiles streams the bytes for every regular file in the manifest from
+// the last SendOffer, after waiting for the receiver's
+// AcceptOffer/RejectOffer response. It reuses that manifest rather than
+// re-walking root, so the tree is only hashed once and the list of files
+// sent is the one offered. Each file is reopened under root and sent in
+// full as it is now; its size and contents are not checked against the
+// offered entry on this side.
+func (s *Session) SendFiles(root string) error {
+	entries := s.offeredEntries
+	if entries == nil {
+		return fmt.Errorf("send files: no pending offer")
+	}
+	s.offeredEntries = nil
+
+	if err := s.recvOfferResponse(); err != nil {
+		return fmt.Errorf("send files: %w", err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir {
+			continue
+		}
+		if err := s.sendFile(filepath.Join(root, filepath.FromSlash(e.RelPath))); err != nil {
+			return fmt.Errorf("send files: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Session) sendFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Send(f)
+}
+
+// RecvFiles writes every entry from the last RecvOffer under root,
+// creating directories as needed and verifying each file's SHA-256 as it
+// writes.
+func (s *Session) RecvFiles(root string) error {
+	entries := s.offerEntries
+	if entries == nil {
+		return fmt.Errorf("recv files: no pending offer")
+	}
+	s.offerEntries = nil
+
+	for _, e := range entries {
+		dest := filepath.Join(root, filepath.FromSlash(e.RelPath))
+		if e.IsDir {
+			if err := os.MkdirAll(dest, os.FileMode(e.Mode)&os.ModePerm); err != nil {
+				return fmt.Errorf("recv files: %w", err)
+			}
+			continue
+		}
+		if err := s.recvFile(dest, e); err != nil {
+			return fmt.Errorf("recv files: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Session) recvFile(dest string, e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(e.Mode)&os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if err := s.Recv(io.MultiWriter(f, h), e.Size); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), e.SHA256[:]) {
+		return fmt.Errorf("checksum mismatch for %v", e.RelPath)
+	}
+	return nil
+}
+
+func encodeEntries(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(entries)))
+	buf.Write(count)
+
+	for _, e := range entries {
+		if len(e.RelPath) > 0xFFFF {
+			return nil, fmt.Errorf("entry path too long: %v bytes", len(e.RelPath))
+		}
+
+		pathLen := make([]byte, 2)
+		binary.BigEndian.PutUint16(pathLen, uint16(len(e.RelPath)))
+		buf.Write(pathLen)
+		buf.WriteString(e.RelPath)
+
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(e.Size))
+		buf.Write(size)
+
+		mode := make([]byte, 4)
+		binary.BigEndian.PutUint32(mode, e.Mode)
+		buf.Write(mode)
+
+		buf.Write(e.SHA256[:])
+
+		if e.IsDir {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeEntries(bs []byte) ([]Entry, error) {
+	r := bytes.NewReader(bs)
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("read count: %w", err)
+	}
+
+	entries := make([]Entry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var pathLen uint16
+		if err := binary.Read(r, binary.BigEndian, &pathLen); err != nil {
+			return nil, fmt.Errorf("read path length: %w", err)
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(r, path); err != nil {
+			return nil, fmt.Errorf("read path: %w", err)
+		}
+
+		var e Entry
+		e.RelPath = string(path)
+
+		if err := binary.Read(r, binary.BigEndian, &e.Size); err != nil {
+			return nil, fmt.Errorf("read size: %w", err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &e.Mode); err != nil {
+			return nil, fmt.Errorf("read mode: %w", err)
+		}
+		if _, err := io.ReadFull(r, e.SHA256[:]); err != nil {
+			return nil, fmt.Errorf("read sha256: %w", err)
+		}
+		isDir, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("read is dir: %w", err)
+		}
+		e.IsDir = isDir == 1
+
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,171 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blissd/golang-storj-solution/pkg/wire"
+)
+
+func TestEncodeDecodeEntriesRoundTrip(t *testing.T) {
+	want := []Entry{
+		{RelPath: "dir", Mode: uint32(os.ModeDir | 0o755), IsDir: true},
+		{RelPath: "dir/file.txt", Size: 11, Mode: 0o644, SHA256: [32]byte{1, 2, 3}},
+	}
+
+	bs, err := encodeEntries(want)
+	if err != nil {
+		t.Fatalf("encodeEntries: %v", err)
+	}
+	got, err := decodeEntries(bs)
+	if err != nil {
+		t.Fatalf("decodeEntries: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entry %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// v2Pair returns a pair of Sessions connected by net.Pipe, already
+// negotiated to V2 framing without going through the wire.Magic handshake.
+func v2Pair() (client, server *Session) {
+	clientConn, serverConn := net.Pipe()
+	clientR := bufio.NewReader(clientConn)
+	serverR := bufio.NewReader(serverConn)
+	client = &Session{conn: clientConn, r: clientR, v2: true,
+		enc: wire.NewEncoderV2(clientConn), dec: wire.NewDecoderV2(clientR)}
+	server = &Session{conn: serverConn, r: serverR, v2: true,
+		enc: wire.NewEncoderV2(serverConn), dec: wire.NewDecoderV2(serverR)}
+	return client, server
+}
+
+func TestOfferAcceptSendRecvRoundTrip(t *testing.T) {
+	srcRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcRoot, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir sub: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcRoot, "top.txt"), []byte("top level"), 0o644); err != nil {
+		t.Fatalf("write top.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcRoot, "sub", "nested.txt"), []byte("nested contents"), 0o644); err != nil {
+		t.Fatalf("write nested.txt: %v", err)
+	}
+
+	entries, err := BuildEntries(srcRoot)
+	if err != nil {
+		t.Fatalf("BuildEntries: %v", err)
+	}
+
+	sender, receiver := v2Pair()
+	defer sender.Close()
+	defer receiver.Close()
+
+	dstRoot := t.TempDir()
+	senderDone := make(chan error, 1)
+	go func() {
+		if err := sender.SendOffer(entries); err != nil {
+			senderDone <- err
+			return
+		}
+		senderDone <- sender.SendFiles(srcRoot)
+	}()
+
+	got, err := receiver.RecvOffer()
+	if err != nil {
+		t.Fatalf("RecvOffer: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("RecvOffer: got %d entries, want %d", len(got), len(entries))
+	}
+	if err := receiver.AcceptOffer(); err != nil {
+		t.Fatalf("AcceptOffer: %v", err)
+	}
+	if err := receiver.RecvFiles(dstRoot); err != nil {
+		t.Fatalf("RecvFiles: %v", err)
+	}
+	if err := <-senderDone; err != nil {
+		t.Fatalf("sender side: %v", err)
+	}
+
+	for _, rel := range []string{"top.txt", "sub/nested.txt"} {
+		want, err := os.ReadFile(filepath.Join(srcRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("read src %v: %v", rel, err)
+		}
+		gotBytes, err := os.ReadFile(filepath.Join(dstRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatalf("read dst %v: %v", rel, err)
+		}
+		if !bytes.Equal(gotBytes, want) {
+			t.Fatalf("%v: got %q, want %q", rel, gotBytes, want)
+		}
+	}
+}
+
+func TestOfferRejected(t *testing.T) {
+	srcRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcRoot, "f.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("write f.txt: %v", err)
+	}
+	entries, err := BuildEntries(srcRoot)
+	if err != nil {
+		t.Fatalf("BuildEntries: %v", err)
+	}
+
+	sender, receiver := v2Pair()
+	defer sender.Close()
+	defer receiver.Close()
+
+	senderDone := make(chan error, 1)
+	go func() {
+		if err := sender.SendOffer(entries); err != nil {
+			senderDone <- err
+			return
+		}
+		senderDone <- sender.SendFiles(srcRoot)
+	}()
+
+	if _, err := receiver.RecvOffer(); err != nil {
+		t.Fatalf("RecvOffer: %v", err)
+	}
+	if err := receiver.RejectOffer("no thanks"); err != nil {
+		t.Fatalf("RejectOffer: %v", err)
+	}
+
+	if err := <-senderDone; err == nil {
+		t.Fatal("SendFiles: expected error after rejection, got nil")
+	}
+}
+
+func TestRecvFilesChecksumMismatchDetected(t *testing.T) {
+	content := []byte("authentic contents")
+	entries := []Entry{
+		{RelPath: "bad.txt", Size: int64(len(content)), Mode: 0o644, SHA256: [32]byte{0xDE, 0xAD, 0xBE, 0xEF}},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	receiver := &Session{conn: serverConn, r: bufio.NewReader(serverConn), offerEntries: entries}
+
+	go func() {
+		_, _ = clientConn.Write(content)
+	}()
+
+	dstRoot := t.TempDir()
+	err := receiver.RecvFiles(dstRoot)
+	if err == nil {
+		t.Fatal("RecvFiles: expected checksum mismatch error, got nil")
+	}
+}
@@ -0,0 +1,188 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// Encoded resume offer: how much of the file the receiver already has.
+	msgResumeOffer byte = 9
+
+	// Encoded resume ack: the offset the sender will resume from.
+	msgResumeAck byte = 10
+
+	// Encoded resume reject: the receiver's prefix didn't match, start over.
+	msgResumeReject byte = 11
+)
+
+// SendResumable sends totalLen bytes from r, first negotiating a resume
+// offset with the receiver: it waits for the resume offer RecvResumable
+// sends, verifies the claimed prefix against r's own bytes, then sends
+// only the remaining tail. Callers that don't need resume should use
+// Send instead.
+func (s *Session) SendResumable(r io.ReadSeeker, totalLen int64) error {
+	if !s.v2 {
+		return fmt.Errorf("send resumable: requires V2 framing")
+	}
+
+	ft, bs, err := s.dec.DecodeBytes()
+	if err != nil {
+		return fmt.Errorf("send resumable: %w", err)
+	}
+	if ft != msgResumeOffer {
+		return fmt.Errorf("send resumable: expected %v, got %v", msgResumeOffer, ft)
+	}
+	haveBytes, haveSum, err := decodeResumeOffer(bs)
+	if err != nil {
+		return fmt.Errorf("send resumable: %w", err)
+	}
+
+	startAt, err := verifyResumePrefix(r, haveBytes, haveSum)
+	if err != nil {
+		return fmt.Errorf("send resumable: %w", err)
+	}
+
+	if startAt == haveBytes && startAt > 0 {
+		if err := s.enc.EncodeInt64(msgResumeAck, startAt); err != nil {
+			return fmt.Errorf("send resumable: %w", err)
+		}
+	} else {
+		startAt = 0
+		if err := s.enc.EncodeByte(msgResumeReject, 0); err != nil {
+			return fmt.Errorf("send resumable: %w", err)
+		}
+	}
+
+	if _, err := r.Seek(startAt, io.SeekStart); err != nil {
+		return fmt.Errorf("send resumable: %w", err)
+	}
+	tail := &io.LimitedReader{R: r, N: totalLen - startAt}
+	if err := s.Send(tail); err != nil {
+		return fmt.Errorf("send resumable: %w", err)
+	}
+	if tail.N > 0 {
+		return fmt.Errorf("send resumable: %w", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// verifyResumePrefix hashes the first haveBytes of r and reports the
+// offset to resume from: haveBytes if it matches haveSum, 0 otherwise.
+func verifyResumePrefix(r io.ReadSeeker, haveBytes int64, haveSum [32]byte) (int64, error) {
+	if haveBytes <= 0 {
+		return 0, nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, r, haveBytes); err == io.EOF {
+		// r is shorter than the claimed prefix, so it can't match.
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	if sum != haveSum {
+		return 0, nil
+	}
+	return haveBytes, nil
+}
+
+// RecvResumable receives totalLen bytes into path, resuming a previous
+// attempt if a partial file is already there: it hashes what's on disk,
+// offers that prefix to the sender, and appends whatever tail comes back.
+func (s *Session) RecvResumable(path string, totalLen int64) error {
+	if !s.v2 {
+		return fmt.Errorf("recv resumable: requires V2 framing")
+	}
+
+	haveBytes, haveSum, err := hashResumePrefix(path)
+	if err != nil {
+		return fmt.Errorf("recv resumable: %w", err)
+	}
+
+	if err := s.enc.EncodeBytes(msgResumeOffer, encodeResumeOffer(haveBytes, haveSum)); err != nil {
+		return fmt.Errorf("recv resumable: %w", err)
+	}
+
+	ft, bs, err := s.dec.DecodeBytes()
+	if err != nil {
+		return fmt.Errorf("recv resumable: %w", err)
+	}
+
+	var startAt int64
+	switch ft {
+	case msgResumeAck:
+		if len(bs) != 8 {
+			return fmt.Errorf("recv resumable: bad resume ack")
+		}
+		startAt = int64(binary.BigEndian.Uint64(bs))
+	case msgResumeReject:
+		startAt = 0
+	default:
+		return fmt.Errorf("recv resumable: expected resume response, got %v", ft)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if startAt > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("recv resumable: %w", err)
+	}
+	defer f.Close()
+
+	if err := s.Recv(f, totalLen-startAt); err != nil {
+		return fmt.Errorf("recv resumable: %w", err)
+	}
+	return nil
+}
+
+// hashResumePrefix hashes whatever is already at path, returning 0 and a
+// zero sum if the file doesn't exist yet.
+func hashResumePrefix(path string) (int64, [32]byte, error) {
+	var sum [32]byte
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, sum, nil
+	}
+	if err != nil {
+		return 0, sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return n, sum, nil
+}
+
+func encodeResumeOffer(haveBytes int64, sum [32]byte) []byte {
+	bs := make([]byte, 8+len(sum))
+	binary.BigEndian.PutUint64(bs[:8], uint64(haveBytes))
+	copy(bs[8:], sum[:])
+	return bs
+}
+
+func decodeResumeOffer(bs []byte) (int64, [32]byte, error) {
+	var sum [32]byte
+	if len(bs) != 8+len(sum) {
+		return 0, sum, fmt.Errorf("bad resume offer length: %v", len(bs))
+	}
+	haveBytes := int64(binary.BigEndian.Uint64(bs[:8]))
+	copy(sum[:], bs[8:])
+	return haveBytes, sum, nil
+}
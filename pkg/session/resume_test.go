@@ -0,0 +1,128 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// limitedConn simulates a connection that drops after a fixed number of
+// bytes have been read from it, standing in for a mid-transfer disconnect.
+type limitedConn struct {
+	net.Conn
+	limit int
+	read  int
+}
+
+func (lc *limitedConn) Read(p []byte) (int, error) {
+	if lc.read >= lc.limit {
+		lc.Conn.Close()
+		return 0, io.ErrClosedPipe
+	}
+	if allowed := lc.limit - lc.read; len(p) > allowed {
+		p = p[:allowed]
+	}
+	n, err := lc.Conn.Read(p)
+	lc.read += n
+	if lc.read >= lc.limit {
+		lc.Conn.Close()
+	}
+	return n, err
+}
+
+func TestResumableSurvivesMidTransferDisconnect(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.bin")
+	dstPath := filepath.Join(dir, "dst.bin")
+
+	const size = 200_000
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	// First attempt: the receiver's connection is cut a bit past the
+	// handshake, partway through the file, so dstPath is left partial.
+	runAttempt(t, ln, srcPath, dstPath, size, size/3)
+
+	if fi, err := os.Stat(dstPath); err != nil {
+		t.Fatalf("stat partial dst: %v", err)
+	} else if fi.Size() == 0 || fi.Size() >= size {
+		t.Fatalf("partial dst size = %v, want somewhere between 0 and %v", fi.Size(), size)
+	}
+
+	// Second attempt: an unbroken connection resumes from the receiver's
+	// partial file and finishes the transfer.
+	runAttempt(t, ln, srcPath, dstPath, size, 0)
+
+	got, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("read dst: %v", err)
+	}
+	wantSum := sha256.Sum256(content)
+	gotSum := sha256.Sum256(got)
+	if wantSum != gotSum {
+		t.Fatalf("resumed file checksum mismatch (len got=%v want=%v)", len(got), len(content))
+	}
+}
+
+// runAttempt drives one SendResumable/RecvResumable pair over a fresh
+// connection to ln. If readLimit is > 0, the receiver's connection is
+// wrapped to fail after readLimit bytes, simulating a dropped connection;
+// errors from that attempt are expected and ignored.
+func runAttempt(t *testing.T, ln net.Listener, srcPath, dstPath string, totalLen int64, readLimit int) {
+	t.Helper()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		var sess *Session
+		if readLimit > 0 {
+			sess = Attach(&limitedConn{Conn: conn, limit: readLimit})
+		} else {
+			sess = Attach(conn)
+		}
+		serverDone <- sess.RecvResumable(dstPath, totalLen)
+	}()
+
+	clientSess, err := New(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer clientSess.Close()
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		t.Fatalf("open src: %v", err)
+	}
+	defer src.Close()
+
+	sendErr := clientSess.SendResumable(src, totalLen)
+	recvErr := <-serverDone
+
+	if readLimit == 0 {
+		if sendErr != nil {
+			t.Fatalf("SendResumable: %v", sendErr)
+		}
+		if recvErr != nil {
+			t.Fatalf("RecvResumable: %v", recvErr)
+		}
+	}
+}
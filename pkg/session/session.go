@@ -1,9 +1,12 @@
 package session
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"net"
+
+	"github.com/blissd/golang-storj-solution/pkg/wire"
 )
 
 type state byte
@@ -34,26 +37,107 @@ const (
 
 type Session struct {
 	conn net.Conn
+	r    *bufio.Reader
+
+	// v2 is true once the peer has negotiated the length-prefixed V2
+	// framing via the wire.Magic handshake. When false, Session falls
+	// back to the legacy single-byte-length frames for compatibility
+	// with older peers.
+	v2  bool
+	enc wire.FrameEncoderV2
+	dec wire.FrameDecoderV2
+
+	// encrypted is true for sessions built by NewEncrypted/AttachEncrypted.
+	// enc/dec above still do the V2 framing, but they write through and
+	// read from sealedOut/sealedIn so every frame, and the bulk transfer
+	// stream, is NaCl-box sealed.
+	encrypted bool
+	sealedOut *sealingWriter
+	sealedIn  *openingReader
+
+	// offerEntries holds the manifest from the most recent RecvOffer,
+	// consumed by the following RecvFiles call.
+	offerEntries []Entry
+
+	// offeredEntries holds the manifest from the most recent SendOffer,
+	// consumed by the following SendFiles call so it doesn't have to
+	// re-walk and re-hash the tree.
+	offeredEntries []Entry
 }
 
 func (s *Session) Close() error {
 	return s.conn.Close()
 }
 
+// New dials addr and negotiates V2 framing by sending wire.Magic first.
+// A peer that doesn't understand V2 framing simply never reads it, so New
+// always speaks V2 from a fresh connection; Attach is the side that falls
+// back for legacy peers.
 func New(addr string) (*Session, error) {
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("new session: %w", err)
 	}
-	return &Session{conn: conn}, nil
+	if err := wire.WriteMagic(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("new session: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	return &Session{
+		conn: conn,
+		r:    r,
+		v2:   true,
+		enc:  wire.NewEncoderV2(conn),
+		dec:  wire.NewDecoderV2(r),
+	}, nil
 }
 
+// Attach wraps an accepted connection as a Session, peeking at the first
+// bytes to decide whether the peer spoke the wire.Magic handshake. If it
+// didn't, Attach falls back to the legacy framing so older peers keep
+// working.
 func Attach(conn net.Conn) *Session {
-	return &Session{conn: conn}
+	r := bufio.NewReader(conn)
+	s := &Session{conn: conn, r: r}
+
+	if looksLikeMagic(r) {
+		_, _ = r.Discard(len(wire.Magic))
+		s.v2 = true
+		s.enc = wire.NewEncoderV2(conn)
+		s.dec = wire.NewDecoderV2(r)
+	}
+	return s
+}
+
+// looksLikeMagic peeks at wire.Magic one byte at a time, bailing out as
+// soon as a byte doesn't match. A legacy peer's first frame can be as
+// short as 2 bytes before it blocks waiting for a reply, so peeking all
+// len(wire.Magic) bytes up front would block forever on that peer;
+// checking incrementally lets a mismatch on an early byte fall back to
+// legacy framing without reading past what the peer actually sent.
+func looksLikeMagic(r *bufio.Reader) bool {
+	for i := 1; i <= len(wire.Magic); i++ {
+		peek, err := r.Peek(i)
+		if err != nil {
+			return false
+		}
+		if peek[i-1] != wire.Magic[i-1] {
+			return false
+		}
+	}
+	return true
 }
 
 // get the first message sent to a new connection
 func (s *Session) FirstByte() (byte, error) {
+	if s.v2 {
+		_, b, err := s.dec.DecodeByte()
+		if err != nil {
+			return 0, fmt.Errorf("first byte: %w", err)
+		}
+		return b, nil
+	}
+
 	bs, err := s.nextFrame()
 	if err != nil {
 		return 0, fmt.Errorf("first byte: %w", err)
@@ -65,26 +149,69 @@ func (s *Session) FirstByte() (byte, error) {
 	return bs[1], nil
 }
 
+// SendFileName sends name, which may be a full path: V2 framing has no
+// 253-byte limit on strings.
 func (s *Session) SendFileName(name string) error {
+	if s.v2 {
+		if err := s.enc.EncodeString(msgFileName, name); err != nil {
+			return fmt.Errorf("send file name: %w", err)
+		}
+		return nil
+	}
 	return s.sendString(msgFileName, name)
 }
 
 func (s *Session) RecvFileName() (string, error) {
+	if s.v2 {
+		ft, v, err := s.dec.DecodeString()
+		if err != nil {
+			return "", fmt.Errorf("recv file name: %w", err)
+		}
+		if ft != msgFileName {
+			return "", fmt.Errorf("expected %v, got %v", msgFileName, ft)
+		}
+		return v, nil
+	}
 	v, err := s.recvString(msgFileName)
 	return v, err
 }
 
 func (s *Session) SendSecret(secret string) error {
+	if s.v2 {
+		if err := s.enc.EncodeString(msgSecretCode, secret); err != nil {
+			return fmt.Errorf("send secret: %w", err)
+		}
+		return nil
+	}
 	return s.sendString(msgSecretCode, secret)
 }
 
 func (s *Session) RecvSecret() (string, error) {
+	if s.v2 {
+		ft, v, err := s.dec.DecodeString()
+		if err != nil {
+			return "", fmt.Errorf("recv secret: %w", err)
+		}
+		if ft != msgSecretCode {
+			return "", fmt.Errorf("expected %v, got %v", msgSecretCode, ft)
+		}
+		return v, nil
+	}
 	v, err := s.recvString(msgSecretCode)
 	return v, err
 }
 
-func (s *Session) SendFileLength(length uint32) error {
-	bs, err := encodeUint32(msgFileLength, length)
+// SendFileLength sends length. V2 framing encodes it as a full int64, so
+// files are no longer capped at 4 GiB.
+func (s *Session) SendFileLength(length int64) error {
+	if s.v2 {
+		if err := s.enc.EncodeInt64(msgFileLength, length); err != nil {
+			return fmt.Errorf("send file length: %w", err)
+		}
+		return nil
+	}
+
+	bs, err := encodeUint32(msgFileLength, uint32(length))
 	if err != nil {
 		return fmt.Errorf("send file length: %w", err)
 	}
@@ -96,7 +223,18 @@ func (s *Session) SendFileLength(length uint32) error {
 	return nil
 }
 
-func (s *Session) RecvFileLength() (uint32, error) {
+func (s *Session) RecvFileLength() (int64, error) {
+	if s.v2 {
+		ft, v, err := s.dec.DecodeInt64()
+		if err != nil {
+			return 0, fmt.Errorf("recv file length: %w", err)
+		}
+		if ft != msgFileLength {
+			return 0, fmt.Errorf("expected %v, got %v", msgFileLength, ft)
+		}
+		return v, nil
+	}
+
 	f, err := s.nextFrame()
 	if err != nil {
 		return 0, fmt.Errorf("recv file length: %w", err)
@@ -108,12 +246,18 @@ func (s *Session) RecvFileLength() (uint32, error) {
 	} else if ft != msgFileLength {
 		return 0, fmt.Errorf("expected %v, got %v", msgFileLength, ft)
 	}
-	return v, err
+	return int64(v), nil
 }
 
 // Informs server that client is a receiver.
 // Informs sender that receiver is connected and ready.
 func (s *Session) SendSendReady() error {
+	if s.v2 {
+		if err := s.enc.EncodeByte(MsgSend, MsgSend); err != nil {
+			return fmt.Errorf("send ready: %w", err)
+		}
+		return nil
+	}
 	bs, err := EncodeByte(MsgSend)
 	if err != nil {
 		return fmt.Errorf("send ready: %w", err)
@@ -125,6 +269,12 @@ func (s *Session) SendSendReady() error {
 // Informs server that client is a receiver.
 // Informs sender that receiver is connected and ready.
 func (s *Session) SendRecvReady() error {
+	if s.v2 {
+		if err := s.enc.EncodeByte(MsgRecv, MsgRecv); err != nil {
+			return fmt.Errorf("recv ready: %w", err)
+		}
+		return nil
+	}
 	bs, err := EncodeByte(MsgRecv)
 	if err != nil {
 		return fmt.Errorf("recv ready: %w", err)
@@ -136,6 +286,17 @@ func (s *Session) SendRecvReady() error {
 // Informs server that client is a receiver.
 // Informs sender that receiver is connected and ready.
 func (s *Session) WaitForRecv() error {
+	if s.v2 {
+		ft, b, err := s.dec.DecodeByte()
+		if err != nil {
+			return fmt.Errorf("wait for recv: %w", err)
+		}
+		if ft != MsgRecv || b != MsgRecv {
+			return fmt.Errorf("expected %v, got %v", MsgRecv, b)
+		}
+		return nil
+	}
+
 	bs, err := s.nextFrame()
 	if err != nil {
 		return fmt.Errorf("wait for recv: %w", err)
@@ -151,26 +312,34 @@ func (s *Session) WaitForRecv() error {
 }
 
 func (s *Session) Send(r io.Reader) error {
+	if s.encrypted {
+		return s.sendEncrypted(r)
+	}
 	_, err := io.Copy(s.conn, r)
 	return err
 }
 
-func (s *Session) Recv(w io.Writer, length int32) error {
-	_, err := io.CopyN(w, s.conn, int64(length))
+// Recv copies length bytes from the peer into w. length is int64 so V2's
+// wider framing isn't immediately capped again at 2 GiB.
+func (s *Session) Recv(w io.Writer, length int64) error {
+	if s.encrypted {
+		return s.recvEncrypted(w, length)
+	}
+	_, err := io.CopyN(w, s.r, length)
 	return err
 }
 
 // reads the next from from the connection
 func (s *Session) nextFrame() ([]byte, error) {
 	length := make([]byte, 1)
-	_, err := s.conn.Read(length)
+	_, err := s.r.Read(length)
 	if err != nil {
 		return nil, fmt.Errorf("next frame: %w", err)
 	}
 
 	frame := make([]byte, length[0]+1)
 	frame[0] = length[0]
-	_, err = s.conn.Read(frame[1:])
+	_, err = s.r.Read(frame[1:])
 	return frame, err
 }
 
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"io"
+	"net"
+)
+
+// Write sends p as raw bulk-transfer bytes, the same stream Send/Recv use.
+// It exists so *Session satisfies io.Writer, which io.Copy requires of its
+// destination before it will even consider the io.ReaderFrom optimization
+// ReadFrom provides.
+func (s *Session) Write(p []byte) (int, error) {
+	if s.encrypted {
+		return s.sealedOut.Write(p)
+	}
+	return s.conn.Write(p)
+}
+
+// Read receives raw bulk-transfer bytes, the same stream Send/Recv use. It
+// exists so *Session satisfies io.Reader, which io.Copy requires of its
+// source before it will even consider the io.WriterTo optimization WriteTo
+// provides.
+func (s *Session) Read(p []byte) (int, error) {
+	if s.encrypted {
+		return s.sealedIn.Read(p)
+	}
+	return s.r.Read(p)
+}
+
+// ReadFrom implements io.ReaderFrom, delegating to the underlying
+// net.TCPConn when there is one so io.Copy(session, r) can use sendfile(2)
+// directly from r's file descriptor into the socket instead of bouncing
+// the bytes through a userspace buffer.
+func (s *Session) ReadFrom(r io.Reader) (int64, error) {
+	if s.encrypted {
+		return io.Copy(s.sealedOut, r)
+	}
+	if tc, ok := s.conn.(*net.TCPConn); ok {
+		return tc.ReadFrom(r)
+	}
+	return io.Copy(s.conn, r)
+}
+
+// WriteTo implements io.WriterTo, delegating to the underlying net.TCPConn
+// when there is one so io.Copy(w, session) can use splice(2) when w is
+// also backed by a socket. Any bytes already buffered by Session (from a
+// version-handshake peek) are drained first so none are lost.
+func (s *Session) WriteTo(w io.Writer) (int64, error) {
+	if s.encrypted {
+		return io.Copy(w, s.sealedIn)
+	}
+	if tc, ok := s.conn.(*net.TCPConn); ok && s.r.Buffered() == 0 {
+		return io.Copy(w, tc)
+	}
+	return io.Copy(w, s.r)
+}
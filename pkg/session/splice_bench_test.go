@@ -0,0 +1,136 @@
+package session
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+// benchPayloadSize matches the 1 GiB transfer size the request asked the
+// benchmarks to compare.
+const benchPayloadSize = 1 << 30
+
+func benchSourceFile(b *testing.B) *os.File {
+	b.Helper()
+	f, err := os.CreateTemp("", "session-bench-*.bin")
+	if err != nil {
+		b.Fatalf("create temp file: %v", err)
+	}
+	if err := f.Truncate(benchPayloadSize); err != nil {
+		b.Fatalf("truncate temp file: %v", err)
+	}
+	b.Cleanup(func() {
+		name := f.Name()
+		f.Close()
+		os.Remove(name)
+	})
+	return f
+}
+
+// loopbackPair returns a connected pair of real TCP sockets. Unlike
+// net.Pipe, these are backed by actual file descriptors, so sendfile(2)
+// and splice(2) have something to act on.
+func loopbackPair(b *testing.B) (client, server net.Conn) {
+	b.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	serverCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			b.Error(err)
+			close(serverCh)
+			return
+		}
+		serverCh <- conn
+	}()
+
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatalf("dial: %v", err)
+	}
+	server = <-serverCh
+	return client, server
+}
+
+// BenchmarkSendCopyThroughSession is the pre-chunk0-5 path: Session.Send
+// wraps io.Copy(s.conn, r) itself rather than letting the caller's
+// io.Copy see a ReaderFrom on Session.
+func BenchmarkSendCopyThroughSession(b *testing.B) {
+	src := benchSourceFile(b)
+	b.SetBytes(benchPayloadSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		client, server := loopbackPair(b)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(io.Discard, server)
+			done <- err
+		}()
+
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			b.Fatalf("seek: %v", err)
+		}
+		sess := &Session{conn: client}
+		b.StartTimer()
+
+		if err := sess.Send(src); err != nil {
+			b.Fatalf("Send: %v", err)
+		}
+		b.StopTimer()
+
+		client.Close()
+		if err := <-done; err != nil && err != io.EOF {
+			b.Fatalf("discard: %v", err)
+		}
+		server.Close()
+		b.StartTimer()
+	}
+}
+
+// BenchmarkSendSpliced is the chunk0-5 path: io.Copy(session, src)
+// dispatches to Session.ReadFrom, which hands the raw *net.TCPConn to
+// src's own ReadFrom, triggering sendfile(2) straight from the file
+// descriptor into the socket.
+func BenchmarkSendSpliced(b *testing.B) {
+	src := benchSourceFile(b)
+	b.SetBytes(benchPayloadSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		client, server := loopbackPair(b)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(io.Discard, server)
+			done <- err
+		}()
+
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			b.Fatalf("seek: %v", err)
+		}
+		sess := &Session{conn: client}
+		b.StartTimer()
+
+		if _, err := io.Copy(sess, src); err != nil {
+			b.Fatalf("io.Copy: %v", err)
+		}
+		b.StopTimer()
+
+		client.Close()
+		if err := <-done; err != nil && err != io.EOF {
+			b.Fatalf("discard: %v", err)
+		}
+		server.Close()
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,159 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Magic is written once at the start of a connection, before any frames,
+// so that a peer speaking a different protocol version fails fast instead
+// of misinterpreting the first frame it reads.
+var Magic = [8]byte{'S', 'T', 'O', 'R', 'J', 0, 0, 1}
+
+// MaxFrameLength bounds the payload of a single V2 frame, well short of
+// the full uint32 range the wire length field allows, so a bogus or
+// malicious header can't make a decoder allocate gigabytes up front. It's
+// sized generously above the 2^24+1 boundary callers are expected to
+// round-trip; bulk file data is chunked by callers rather than sent as
+// one frame.
+const MaxFrameLength = 1<<24 + 1<<20
+
+// FrameEncoderV2 replaces FrameEncoder's single-byte length prefix with a
+// frameType byte followed by a big-endian uint32 length, removing the
+// 255-byte cap on strings and allowing 64-bit lengths.
+type FrameEncoderV2 interface {
+	EncodeByte(frameType byte, b byte) error
+	EncodeString(frameType byte, s string) error
+	EncodeInt64(frameType byte, i int64) error
+	EncodeBytes(frameType byte, payload []byte) error
+}
+
+// FrameDecoderV2 decodes frames written by a FrameEncoderV2.
+type FrameDecoderV2 interface {
+	DecodeByte() (frameType byte, b byte, err error)
+	DecodeString() (frameType byte, s string, err error)
+	DecodeInt64() (frameType byte, i int64, err error)
+	DecodeBytes() (frameType byte, payload []byte, err error)
+}
+
+type frameEncoderV2 struct {
+	io.Writer
+}
+
+type frameDecoderV2 struct {
+	io.Reader
+}
+
+// NewEncoderV2 returns a FrameEncoderV2 writing to w.
+func NewEncoderV2(w io.Writer) FrameEncoderV2 {
+	return &frameEncoderV2{Writer: w}
+}
+
+// NewDecoderV2 returns a FrameDecoderV2 reading from r.
+func NewDecoderV2(r io.Reader) FrameDecoderV2 {
+	return &frameDecoderV2{Reader: r}
+}
+
+func (enc *frameEncoderV2) EncodeByte(frameType byte, b byte) error {
+	return enc.EncodeBytes(frameType, []byte{b})
+}
+
+func (enc *frameEncoderV2) EncodeString(frameType byte, s string) error {
+	return enc.EncodeBytes(frameType, []byte(s))
+}
+
+func (enc *frameEncoderV2) EncodeInt64(frameType byte, i int64) error {
+	bs := make([]byte, 8)
+	binary.BigEndian.PutUint64(bs, uint64(i))
+	return enc.EncodeBytes(frameType, bs)
+}
+
+func (enc *frameEncoderV2) EncodeBytes(frameType byte, payload []byte) error {
+	if len(payload) > MaxFrameLength {
+		return fmt.Errorf("wire.EncodeBytes: payload too large: %v", len(payload))
+	}
+	// Write the header and payload in a single Write call, even though
+	// Writer would happily accept two: callers on top of an encrypting
+	// Writer (see session.sealingWriter) turn every Write into its own
+	// sealed envelope, and a split write leaves an empty-payload envelope
+	// that a zero-length frame's decoder never consumes, desyncing the
+	// stream from the next frame on.
+	frame := make([]byte, 5+len(payload))
+	frame[0] = frameType
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	if _, err := enc.Write(frame); err != nil {
+		return fmt.Errorf("wire.EncodeBytes: %w", err)
+	}
+	return nil
+}
+
+func (dec *frameDecoderV2) DecodeByte() (byte, byte, error) {
+	ft, bs, err := dec.DecodeBytes()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(bs) != 1 {
+		return 0, 0, fmt.Errorf("wire.DecodeByte: bad length: %v", len(bs))
+	}
+	return ft, bs[0], nil
+}
+
+func (dec *frameDecoderV2) DecodeString() (byte, string, error) {
+	ft, bs, err := dec.DecodeBytes()
+	if err != nil {
+		return 0, "", err
+	}
+	return ft, string(bs), nil
+}
+
+func (dec *frameDecoderV2) DecodeInt64() (byte, int64, error) {
+	ft, bs, err := dec.DecodeBytes()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(bs) != 8 {
+		return 0, 0, fmt.Errorf("wire.DecodeInt64: bad length: %v", len(bs))
+	}
+	return ft, int64(binary.BigEndian.Uint64(bs)), nil
+}
+
+func (dec *frameDecoderV2) DecodeBytes() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(dec, header); err != nil {
+		return 0, nil, fmt.Errorf("wire.DecodeBytes: read header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxFrameLength {
+		return 0, nil, fmt.Errorf("wire.DecodeBytes: frame too large: %v", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(dec, payload); err != nil {
+		return 0, nil, fmt.Errorf("wire.DecodeBytes: read payload: %w", err)
+	}
+	return header[0], payload, nil
+}
+
+// WriteMagic writes the connection-setup handshake. It must be the first
+// thing either peer writes to the connection.
+func WriteMagic(w io.Writer) error {
+	if _, err := w.Write(Magic[:]); err != nil {
+		return fmt.Errorf("wire.WriteMagic: %w", err)
+	}
+	return nil
+}
+
+// ReadMagic reads and validates the handshake written by WriteMagic.
+func ReadMagic(r io.Reader) error {
+	bs := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return fmt.Errorf("wire.ReadMagic: %w", err)
+	}
+	for i := range Magic {
+		if bs[i] != Magic[i] {
+			return fmt.Errorf("wire.ReadMagic: bad magic: %v", bs)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameV2RoundTripBytes(t *testing.T) {
+	sizes := []int{0, 1, 1 << 16, 1<<24 + 1}
+
+	for _, size := range sizes {
+		payload := make([]byte, size)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+		enc := NewEncoderV2(&buf)
+		if err := enc.EncodeBytes(42, payload); err != nil {
+			t.Fatalf("size %v: EncodeBytes: %v", size, err)
+		}
+
+		dec := NewDecoderV2(&buf)
+		ft, got, err := dec.DecodeBytes()
+		if err != nil {
+			t.Fatalf("size %v: DecodeBytes: %v", size, err)
+		}
+		if ft != 42 {
+			t.Fatalf("size %v: frame type = %v, want 42", size, ft)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("size %v: payload mismatch", size)
+		}
+	}
+}
+
+func TestFrameV2RoundTripString(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoderV2(&buf)
+	if err := enc.EncodeString(7, "hello"); err != nil {
+		t.Fatalf("EncodeString: %v", err)
+	}
+
+	dec := NewDecoderV2(&buf)
+	ft, v, err := dec.DecodeString()
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	if ft != 7 || v != "hello" {
+		t.Fatalf("got (%v, %q), want (7, \"hello\")", ft, v)
+	}
+}
+
+func TestFrameV2RoundTripInt64(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoderV2(&buf)
+	if err := enc.EncodeInt64(3, 1<<40+7); err != nil {
+		t.Fatalf("EncodeInt64: %v", err)
+	}
+
+	dec := NewDecoderV2(&buf)
+	ft, v, err := dec.DecodeInt64()
+	if err != nil {
+		t.Fatalf("DecodeInt64: %v", err)
+	}
+	if ft != 3 || v != 1<<40+7 {
+		t.Fatalf("got (%v, %v), want (3, %v)", ft, v, int64(1<<40+7))
+	}
+}
+
+func TestMagicRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMagic(&buf); err != nil {
+		t.Fatalf("WriteMagic: %v", err)
+	}
+	if err := ReadMagic(&buf); err != nil {
+		t.Fatalf("ReadMagic: %v", err)
+	}
+}
+
+func TestReadMagicRejectsMismatch(t *testing.T) {
+	buf := bytes.NewBufferString("NOPENOP\x00")
+	if err := ReadMagic(buf); err == nil {
+		t.Fatal("ReadMagic: expected error for mismatched magic, got nil")
+	}
+}